@@ -0,0 +1,136 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/goharbor/harbor/src/pkg/permission/types"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		raw     string
+		wantErr bool
+		want    *Resource
+	}{
+		{
+			raw:  "/project/1/repository",
+			want: &Resource{Kind: "project", ProjectID: "1", Subresource: "repository"},
+		},
+		{
+			raw:  "/project/1/artifact-label",
+			want: &Resource{Kind: "project", ProjectID: "1", Subresource: "artifact-label"},
+		},
+		{
+			raw:  "/project/1/Scanner_Run",
+			want: &Resource{Kind: "project", ProjectID: "1", Subresource: "Scanner_Run"},
+		},
+		{
+			raw:  "/project/*/repository",
+			want: &Resource{Kind: "project", ProjectID: "*", Subresource: "repository"},
+		},
+		{
+			raw:  "/project/1/repository/2",
+			want: &Resource{Kind: "project", ProjectID: "1", Subresource: "repository", SubresourceID: "2"},
+		},
+		{
+			raw:  "/project/1/repository/*",
+			want: &Resource{Kind: "project", ProjectID: "1", Subresource: "repository", SubresourceID: "*"},
+		},
+		{
+			raw:  "/project/1",
+			want: &Resource{Kind: "project", ProjectID: "1"},
+		},
+		{
+			raw:     "/project/abc/repository",
+			wantErr: true,
+		},
+		{
+			raw:     "project/1/repository",
+			wantErr: true,
+		},
+		{
+			raw:     "/system/1/repository",
+			wantErr: true,
+		},
+		{
+			raw:     "/anything/1/repository",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := Parse(c.raw)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q): expected error, got none", c.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", c.raw, err)
+			continue
+		}
+		if *got != *c.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", c.raw, got, c.want)
+		}
+	}
+}
+
+func TestResourceExpand(t *testing.T) {
+	res, err := Parse("/project/*/repository")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.IsWildcardProject() {
+		t.Fatalf("expected %q to be a wildcard-project resource", res)
+	}
+
+	expanded := res.Expand([]int64{1, 2})
+	if len(expanded) != 2 {
+		t.Fatalf("expected 2 expanded resources, got %d", len(expanded))
+	}
+	if expanded[0].ProjectID != "1" || expanded[1].ProjectID != "2" {
+		t.Fatalf("unexpected expanded project IDs: %+v", expanded)
+	}
+
+	concrete, err := Parse("/project/1/repository")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if concrete.IsWildcardProject() {
+		t.Fatalf("expected %q not to be a wildcard-project resource", concrete)
+	}
+	if single := concrete.Expand([]int64{1, 2}); len(single) != 1 || single[0] != concrete {
+		t.Fatalf("expected a non-wildcard resource to expand to itself, got %+v", single)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	policies := []*types.Policy{
+		{Action: types.Action("pull"), Resource: types.Resource("repository")},
+		{Action: types.Action("push"), Resource: types.Resource("repository")},
+	}
+
+	res, err := Parse("/project/1/repository")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !Allowed(types.Action("pull"), res, policies) {
+		t.Errorf("expected pull on repository to be allowed")
+	}
+	if Allowed(types.Action("delete"), res, policies) {
+		t.Errorf("expected delete on repository not to be allowed")
+	}
+	if !Allowed(types.Action("*"), res, policies) {
+		t.Errorf("expected wildcard action to be allowed whenever the project grants any action on the resource")
+	}
+
+	other, err := Parse("/project/1/artifact-label")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if Allowed(types.Action("*"), other, policies) {
+		t.Errorf("expected wildcard action on an ungranted resource not to be allowed")
+	}
+}
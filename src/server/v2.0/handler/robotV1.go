@@ -6,13 +6,17 @@ import (
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/strfmt"
 	"github.com/goharbor/harbor/src/common/rbac"
+	"github.com/goharbor/harbor/src/common/security"
 	"github.com/goharbor/harbor/src/common/utils"
 	"github.com/goharbor/harbor/src/controller/project"
 	"github.com/goharbor/harbor/src/controller/robot"
-	"github.com/goharbor/harbor/src/lib"
 	"github.com/goharbor/harbor/src/lib/errors"
 	"github.com/goharbor/harbor/src/lib/log"
+	"github.com/goharbor/harbor/src/lib/orm"
 	"github.com/goharbor/harbor/src/lib/q"
+	"github.com/goharbor/harbor/src/pkg/audit"
+	auditmodel "github.com/goharbor/harbor/src/pkg/audit/model"
+	"github.com/goharbor/harbor/src/pkg/permission/resource"
 	"github.com/goharbor/harbor/src/pkg/permission/types"
 	pkg_robot "github.com/goharbor/harbor/src/pkg/robot2"
 	pkg "github.com/goharbor/harbor/src/pkg/robot2/model"
@@ -20,14 +24,23 @@ import (
 	"github.com/goharbor/harbor/src/server/v2.0/models"
 	operation "github.com/goharbor/harbor/src/server/v2.0/restapi/operations/robotv1"
 	"regexp"
+	"sigs.k8s.io/yaml"
 	"strings"
 )
 
+var (
+	robotSecretLenReg   = regexp.MustCompile(`^.{8,128}$`)
+	robotSecretLowerReg = regexp.MustCompile(`[a-z]`)
+	robotSecretUpperReg = regexp.MustCompile(`[A-Z]`)
+	robotSecretDigitReg = regexp.MustCompile(`[0-9]`)
+)
+
 func newRobotV1API() *robotV1API {
 	return &robotV1API{
 		robotCtl:   robot.Ctl,
 		robotMgr:   pkg_robot.Mgr,
 		projectCtr: project.Ctl,
+		auditMgr:   audit.Mgr,
 	}
 }
 
@@ -36,6 +49,7 @@ type robotV1API struct {
 	robotCtl   robot.Controller
 	robotMgr   pkg_robot.Manager
 	projectCtr project.Controller
+	auditMgr   audit.Manager
 }
 
 func (rAPI *robotV1API) CreateRobotV1(ctx context.Context, params operation.CreateRobotV1Params) middleware.Responder {
@@ -43,33 +57,172 @@ func (rAPI *robotV1API) CreateRobotV1(ctx context.Context, params operation.Crea
 		return rAPI.SendError(ctx, err)
 	}
 
-	if err := rAPI.validate(ctx, params); err != nil {
+	if err := rAPI.validate(ctx, params.ProjectIDOrName, params.Robot); err != nil {
+		return rAPI.SendError(ctx, err)
+	}
+
+	created, err := rAPI.createOneRobotV1(ctx, params.ProjectIDOrName, params.Robot)
+	if err != nil {
 		return rAPI.SendError(ctx, err)
 	}
 
+	location := fmt.Sprintf("%s/%d", strings.TrimSuffix(params.HTTPRequest.URL.Path, "/"), created.ID)
+	return operation.NewCreateRobotV1Created().WithLocation(location).WithPayload(&models.RobotCreated{
+		ID:           created.ID,
+		Name:         created.Name,
+		Secret:       created.Secret,
+		CreationTime: strfmt.DateTime(created.CreationTime),
+	})
+}
+
+// CreateRobotV1Batch creates a set of project robots in a single request.
+func (rAPI *robotV1API) CreateRobotV1Batch(ctx context.Context, params operation.CreateRobotV1BatchParams) middleware.Responder {
+	if err := rAPI.RequireProjectAccess(ctx, params.ProjectIDOrName, rbac.ActionCreate, rbac.ResourceRobot); err != nil {
+		return rAPI.SendError(ctx, err)
+	}
+
+	results := rAPI.batchCreateRobotsV1(ctx, params.ProjectIDOrName, params.Robots, params.DryRun)
+
+	return operation.NewCreateRobotV1BatchOK().WithPayload(results)
+}
+
+// CreateRobotV1Import provisions the robots described by a declarative manifest (YAML or JSON).
+func (rAPI *robotV1API) CreateRobotV1Import(ctx context.Context, params operation.CreateRobotV1ImportParams) middleware.Responder {
+	if err := rAPI.RequireProjectAccess(ctx, params.ProjectIDOrName, rbac.ActionCreate, rbac.ResourceRobot); err != nil {
+		return rAPI.SendError(ctx, err)
+	}
+
+	var manifest robotV1Manifest
+	if err := yaml.Unmarshal([]byte(params.Manifest), &manifest); err != nil {
+		return rAPI.SendError(ctx, errors.New(err).WithMessage("invalid robot manifest").WithCode(errors.BadRequestCode))
+	}
+
+	results := rAPI.batchCreateRobotsV1(ctx, params.ProjectIDOrName, manifestToRobotSpecs(manifest), false)
+
+	return operation.NewCreateRobotV1ImportOK().WithPayload(results)
+}
+
+// robotV1Manifest is the schema accepted by CreateRobotV1Import.
+type robotV1Manifest struct {
+	Robots []struct {
+		Name        string `json:"name" yaml:"name"`
+		Description string `json:"description" yaml:"description"`
+		ExpiresAt   int64  `json:"expires_at" yaml:"expires_at"`
+		Access      []struct {
+			Action   string `json:"action" yaml:"action"`
+			Resource string `json:"resource" yaml:"resource"`
+		} `json:"access" yaml:"access"`
+	} `json:"robots" yaml:"robots"`
+}
+
+// manifestToRobotSpecs converts a parsed manifest into the specs CreateRobotV1Batch works with.
+func manifestToRobotSpecs(manifest robotV1Manifest) []*models.RobotCreate {
+	specs := make([]*models.RobotCreate, 0, len(manifest.Robots))
+	for _, e := range manifest.Robots {
+		access := make([]*models.Access, 0, len(e.Access))
+		for _, a := range e.Access {
+			access = append(access, &models.Access{Action: a.Action, Resource: a.Resource, Effect: string(types.EffectAllow)})
+		}
+		specs = append(specs, &models.RobotCreate{
+			Name:        e.Name,
+			Description: e.Description,
+			ExpiresAt:   e.ExpiresAt,
+			Access:      access,
+		})
+	}
+	return specs
+}
+
+// batchCreateRobotsV1 validates every spec, then - unless dryRun is set - creates them inside
+// a single transaction so a failure on any entry rolls back the rest.
+func (rAPI *robotV1API) batchCreateRobotsV1(ctx context.Context, projectIDOrName string, specs []*models.RobotCreate, dryRun bool) []*models.RobotV1BatchResult {
+	results := make([]*models.RobotV1BatchResult, len(specs))
+	invalid := false
+	for i, spec := range specs {
+		results[i] = &models.RobotV1BatchResult{Name: spec.Name}
+		if err := rAPI.validate(ctx, projectIDOrName, spec); err != nil {
+			results[i].Error = err.Error()
+			invalid = true
+		}
+	}
+	if invalid {
+		for _, r := range results {
+			if r.Error == "" {
+				r.Error = "not attempted: another entry in the batch failed validation"
+			}
+		}
+		return results
+	}
+
+	if dryRun {
+		return results
+	}
+
+	failedAt := -1
+	var failure error
+	err := orm.WithTransaction(func(ctx context.Context) error {
+		for i, spec := range specs {
+			created, err := rAPI.createOneRobotV1(ctx, projectIDOrName, spec)
+			if err != nil {
+				failedAt, failure = i, err
+				return err
+			}
+			results[i].ID = created.ID
+			results[i].Name = created.Name
+			results[i].Secret = created.Secret
+		}
+		return nil
+	})(ctx)
+	if err == nil {
+		return results
+	}
+
+	formatBatchRollbackResults(results, failedAt, failure)
+	return results
+}
+
+// formatBatchRollbackResults clears the creation data from every result and labels each row by
+// its position relative to failedAt.
+func formatBatchRollbackResults(results []*models.RobotV1BatchResult, failedAt int, failure error) {
+	for i, r := range results {
+		r.ID = 0
+		r.Secret = ""
+		switch {
+		case i == failedAt:
+			r.Error = failure.Error()
+		case i < failedAt:
+			r.Error = fmt.Sprintf("rolled back because entry %d failed", failedAt)
+		default:
+			r.Error = fmt.Sprintf("not attempted: batch aborted after entry %d failed", failedAt)
+		}
+	}
+}
+
+// buildRobot translates a robot spec into the robot.Robot model the controller layer expects.
+func (rAPI *robotV1API) buildRobot(ctx context.Context, projectIDOrName string, spec *models.RobotCreate) (*robot.Robot, error) {
 	r := &robot.Robot{
 		Robot: pkg.Robot{
-			Name:        params.Robot.Name,
-			Description: params.Robot.Description,
-			ExpiresAt:   params.Robot.ExpiresAt,
+			Name:        spec.Name,
+			Description: spec.Description,
+			ExpiresAt:   spec.ExpiresAt,
 		},
 		Level: robot.LEVELPROJECT,
 	}
 
-	projectID, projectName, err := utils.ParseProjectIDOrName(params.ProjectIDOrName)
+	projectID, projectName, err := utils.ParseProjectIDOrName(projectIDOrName)
 	if err != nil {
-		return rAPI.SendError(ctx, err)
+		return nil, err
 	}
 
 	if projectID != 0 {
 		p, err := project.Ctl.Get(ctx, projectID)
 		if err != nil {
 			log.Errorf("failed to get project %s: %v", projectName, err)
-			return rAPI.SendError(ctx, err)
+			return nil, err
 		}
 		if p == nil {
 			log.Warningf("project %s not found", projectName)
-			return rAPI.SendError(ctx, err)
+			return nil, err
 		}
 		projectName = p.Name
 	}
@@ -80,38 +233,37 @@ func (rAPI *robotV1API) CreateRobotV1(ctx context.Context, params operation.Crea
 	}
 
 	var policies []*types.Policy
-	for _, acc := range params.Robot.Access {
+	for _, acc := range spec.Access {
 		policy := &types.Policy{
 			Action: types.Action(acc.Action),
 			Effect: types.Effect(acc.Effect),
 		}
-		res, err := getRawResource(acc.Resource)
+		res, err := resource.Parse(acc.Resource)
 		if err != nil {
-			return rAPI.SendError(ctx, err)
+			return nil, err
 		}
-		policy.Resource = types.Resource(res)
+		policy.Resource = types.Resource(res.Subresource)
 		policies = append(policies, policy)
 	}
 	permission.Access = policies
 	r.Permissions = append(r.Permissions, permission)
 
-	rid, err := rAPI.robotCtl.Create(ctx, r)
+	return r, nil
+}
+
+// createOneRobotV1 builds and persists a single robot, returning the freshly created record.
+func (rAPI *robotV1API) createOneRobotV1(ctx context.Context, projectIDOrName string, spec *models.RobotCreate) (*robot.Robot, error) {
+	r, err := rAPI.buildRobot(ctx, projectIDOrName, spec)
 	if err != nil {
-		return rAPI.SendError(ctx, err)
+		return nil, err
 	}
 
-	created, err := rAPI.robotCtl.Get(ctx, rid, nil)
+	rid, err := rAPI.robotCtl.Create(ctx, r)
 	if err != nil {
-		return rAPI.SendError(ctx, err)
+		return nil, err
 	}
 
-	location := fmt.Sprintf("%s/%d", strings.TrimSuffix(params.HTTPRequest.URL.Path, "/"), created.ID)
-	return operation.NewCreateRobotV1Created().WithLocation(location).WithPayload(&models.RobotCreated{
-		ID:           created.ID,
-		Name:         created.Name,
-		Secret:       created.Secret,
-		CreationTime: strfmt.DateTime(created.CreationTime),
-	})
+	return rAPI.robotCtl.Get(ctx, rid, nil)
 }
 
 func (rAPI *robotV1API) DeleteRobotV1(ctx context.Context, params operation.DeleteRobotV1Params) middleware.Responder {
@@ -240,43 +392,124 @@ func (rAPI *robotV1API) UpdateRobotV1(ctx context.Context, params operation.Upda
 	return operation.NewUpdateRobotV1OK()
 }
 
-func (rAPI *robotV1API) validate(ctx context.Context, params operation.CreateRobotV1Params) error {
-	if params.Robot == nil {
-		return errors.New(nil).WithMessage("bad request no robot").WithCode(errors.BadRequestCode)
+func (rAPI *robotV1API) RefreshSecretRobotV1(ctx context.Context, params operation.RefreshSecretRobotV1Params) middleware.Responder {
+	if err := rAPI.RequireProjectAccess(ctx, params.ProjectIDOrName, rbac.ActionUpdate, rbac.ResourceRobot); err != nil {
+		return rAPI.SendError(ctx, err)
 	}
-	if len(params.Robot.Access) == 0 {
-		return errors.New(nil).WithMessage("bad request no access").WithCode(errors.BadRequestCode)
+
+	var callerSecret string
+	if params.RobotSec != nil {
+		callerSecret = params.RobotSec.Secret
 	}
 
-	pro, err := rAPI.projectCtr.Get(ctx, params.ProjectIDOrName)
+	result, err := rAPI.refreshRobotSecret(ctx, params.ProjectIDOrName, params.RobotID, callerSecret)
 	if err != nil {
-		return err
+		return rAPI.SendError(ctx, err)
 	}
 
-	policies := rbac.GetPoliciesOfProject(pro.ProjectID)
+	return operation.NewRefreshSecretRobotV1OK().WithPayload(result)
+}
 
-	mp := map[string]bool{}
-	for _, policy := range policies {
-		mp[policy.String()] = true
+// refreshRobotSecret rotates a project robot's secret in place: the robot keeps its ID, name
+// and permissions, only the secret changes. An empty callerSecret generates a random one.
+func (rAPI *robotV1API) refreshRobotSecret(ctx context.Context, projectIDOrName string, robotID int64, callerSecret string) (*models.RobotSec, error) {
+	pro, err := rAPI.projectCtr.Get(ctx, projectIDOrName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := rAPI.robotCtl.List(ctx, q.New(q.KeyWords{"ProjectID": pro.ProjectID, "ID": robotID}), &robot.Option{
+		WithPermission: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(r) == 0 {
+		return nil, errors.NotFoundError(fmt.Errorf("cannot find robot with project id: %d and id: %d", pro.ProjectID, robotID))
 	}
+	rb := r[0]
 
-	for _, policy := range params.Robot.Access {
-		p := &types.Policy{}
-		lib.JSONCopy(p, policy)
-		if !mp[p.String()] {
-			return errors.New(nil).WithMessage("%s action of %s resource not exist in project %s", policy.Action, policy.Resource, params.ProjectIDOrName).WithCode(errors.BadRequestCode)
+	secret := callerSecret
+	if secret != "" {
+		if err := validateRobotSecret(secret); err != nil {
+			return nil, err
 		}
+	} else {
+		secret, err = utils.GenerateRandomString()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rb.Secret = secret
+	if err := rAPI.robotMgr.Update(ctx, &rb.Robot); err != nil {
+		return nil, err
+	}
+
+	operator := "unknown"
+	if secCtx, ok := security.FromContext(ctx); ok {
+		operator = secCtx.GetUsername()
+	}
+	if _, err := rAPI.auditMgr.Create(ctx, &auditmodel.AuditLog{
+		ProjectID:    pro.ProjectID,
+		Resource:     rb.Name,
+		ResourceType: "robot",
+		Username:     operator,
+		Operation:    "refresh-secret",
+	}); err != nil {
+		log.Errorf("failed to record audit log for secret refresh of robot %s: %v", rb.Name, err)
 	}
 
+	return &models.RobotSec{Secret: secret}, nil
+}
+
+// validateRobotSecret applies Harbor's password policy: 8-128 chars with at least one
+// lowercase letter, one uppercase letter and one digit.
+func validateRobotSecret(secret string) error {
+	if !robotSecretLenReg.MatchString(secret) ||
+		!robotSecretLowerReg.MatchString(secret) ||
+		!robotSecretUpperReg.MatchString(secret) ||
+		!robotSecretDigitReg.MatchString(secret) {
+		return errors.New(nil).WithMessage("secret must be 8 to 128 characters with at least one lowercase letter, one uppercase letter and one digit").WithCode(errors.BadRequestCode)
+	}
 	return nil
 }
 
-// /project/1/repository => repository
-func getRawResource(resource string) (string, error) {
-	resourceReg := regexp.MustCompile("^/project/[0-9]+/(?P<repository>[a-z-]+)$")
-	matches := resourceReg.FindStringSubmatch(resource)
-	if len(matches) <= 1 {
-		return "", errors.New(nil).WithMessage("bad resource %s", resource).WithCode(errors.BadRequestCode)
+func (rAPI *robotV1API) validate(ctx context.Context, projectIDOrName string, spec *models.RobotCreate) error {
+	if spec == nil {
+		return errors.New(nil).WithMessage("bad request no robot").WithCode(errors.BadRequestCode)
+	}
+	if len(spec.Access) == 0 {
+		return errors.New(nil).WithMessage("bad request no access").WithCode(errors.BadRequestCode)
+	}
+
+	pro, err := rAPI.projectCtr.Get(ctx, projectIDOrName)
+	if err != nil {
+		return err
+	}
+
+	policies := rbac.GetPoliciesOfProject(pro.ProjectID)
+
+	for _, policy := range spec.Access {
+		res, err := resource.Parse(policy.Resource)
+		if err != nil {
+			return err
+		}
+
+		// a robot created through this API is always scoped to the single project
+		// identified by projectIDOrName, so a wildcard project segment (e.g.
+		// "/project/*/repository") resolves against that one accessible project rather
+		// than the caller's whole project list.
+		allowed := false
+		for _, expanded := range res.Expand([]int64{pro.ProjectID}) {
+			if resource.Allowed(types.Action(policy.Action), expanded, policies) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.New(nil).WithMessage("%s action of %s resource not exist in project %s", policy.Action, policy.Resource, projectIDOrName).WithCode(errors.BadRequestCode)
+		}
 	}
-	return matches[1], nil
+
+	return nil
 }
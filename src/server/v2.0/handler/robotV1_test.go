@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/goharbor/harbor/src/controller/robot"
+	projectmodels "github.com/goharbor/harbor/src/pkg/project/models"
+	pkgmodel "github.com/goharbor/harbor/src/pkg/robot2/model"
+	"github.com/goharbor/harbor/src/server/v2.0/models"
+	auditTesting "github.com/goharbor/harbor/src/testing/pkg/audit"
+	projectCtlTesting "github.com/goharbor/harbor/src/testing/controller/project"
+	robotCtlTesting "github.com/goharbor/harbor/src/testing/controller/robot"
+	robotMgrTesting "github.com/goharbor/harbor/src/testing/pkg/robot2"
+)
+
+type RobotV1Suite struct {
+	suite.Suite
+	projectCtr *projectCtlTesting.Controller
+	robotCtl   *robotCtlTesting.Controller
+	robotMgr   *robotMgrTesting.Manager
+	auditMgr   *auditTesting.Manager
+	api        *robotV1API
+}
+
+func (suite *RobotV1Suite) SetupTest() {
+	suite.projectCtr = &projectCtlTesting.Controller{}
+	suite.robotCtl = &robotCtlTesting.Controller{}
+	suite.robotMgr = &robotMgrTesting.Manager{}
+	suite.auditMgr = &auditTesting.Manager{}
+	suite.api = &robotV1API{
+		projectCtr: suite.projectCtr,
+		robotCtl:   suite.robotCtl,
+		robotMgr:   suite.robotMgr,
+		auditMgr:   suite.auditMgr,
+	}
+}
+
+func (suite *RobotV1Suite) existingRobot() *robot.Robot {
+	return &robot.Robot{
+		Robot: pkgmodel.Robot{
+			ID:   1,
+			Name: "robot$test",
+		},
+	}
+}
+
+func (suite *RobotV1Suite) TestRefreshRobotSecretGeneratesSecretWhenNoneSupplied() {
+	suite.projectCtr.On("Get", mock.Anything, mock.Anything).Return(&projectmodels.Project{ProjectID: 1}, nil)
+	suite.robotCtl.On("List", mock.Anything, mock.Anything, mock.Anything).Return([]*robot.Robot{suite.existingRobot()}, nil)
+	suite.robotMgr.On("Update", mock.Anything, mock.Anything).Return(nil)
+	suite.auditMgr.On("Create", mock.Anything, mock.Anything).Return(int64(1), nil)
+
+	result, err := suite.api.refreshRobotSecret(context.Background(), "1", 1, "")
+
+	suite.NoError(err)
+	suite.NotEmpty(result.Secret)
+	suite.robotMgr.AssertCalled(suite.T(), "Update", mock.Anything, mock.Anything)
+	suite.auditMgr.AssertCalled(suite.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (suite *RobotV1Suite) TestRefreshRobotSecretRejectsWeakCallerSecret() {
+	suite.projectCtr.On("Get", mock.Anything, mock.Anything).Return(&projectmodels.Project{ProjectID: 1}, nil)
+	suite.robotCtl.On("List", mock.Anything, mock.Anything, mock.Anything).Return([]*robot.Robot{suite.existingRobot()}, nil)
+
+	result, err := suite.api.refreshRobotSecret(context.Background(), "1", 1, "tooweak")
+
+	suite.Error(err)
+	suite.Nil(result)
+	suite.robotMgr.AssertNotCalled(suite.T(), "Update", mock.Anything, mock.Anything)
+}
+
+func (suite *RobotV1Suite) TestRefreshRobotSecretAcceptsStrongCallerSecret() {
+	suite.projectCtr.On("Get", mock.Anything, mock.Anything).Return(&projectmodels.Project{ProjectID: 1}, nil)
+	suite.robotCtl.On("List", mock.Anything, mock.Anything, mock.Anything).Return([]*robot.Robot{suite.existingRobot()}, nil)
+	suite.robotMgr.On("Update", mock.Anything, mock.Anything).Return(nil)
+	suite.auditMgr.On("Create", mock.Anything, mock.Anything).Return(int64(1), nil)
+
+	result, err := suite.api.refreshRobotSecret(context.Background(), "1", 1, "Sup3rSecret!")
+
+	suite.NoError(err)
+	suite.Equal("Sup3rSecret!", result.Secret)
+}
+
+func (suite *RobotV1Suite) TestBatchCreateRobotsV1AbortsWholeBatchOnValidationFailure() {
+	suite.projectCtr.On("Get", mock.Anything, mock.Anything).Return(&projectmodels.Project{ProjectID: 1}, nil)
+
+	specs := []*models.RobotCreate{
+		{Name: "good", Access: []*models.Access{{Action: "pull", Resource: "/project/1/repository", Effect: "allow"}}},
+		{Name: "bad", Access: nil},
+	}
+
+	results := suite.api.batchCreateRobotsV1(context.Background(), "1", specs, false)
+
+	suite.Len(results, 2)
+	suite.NotEmpty(results[0].Error)
+	suite.NotEmpty(results[1].Error)
+	suite.robotCtl.AssertNotCalled(suite.T(), "Create", mock.Anything, mock.Anything)
+}
+
+func (suite *RobotV1Suite) TestFormatBatchRollbackResultsLabelsRowsByPosition() {
+	results := []*models.RobotV1BatchResult{
+		{Name: "before", ID: 1, Secret: "s1"},
+		{Name: "failing"},
+		{Name: "after"},
+	}
+	failure := errors.New("duplicate robot name")
+
+	formatBatchRollbackResults(results, 1, failure)
+
+	suite.Zero(results[0].ID)
+	suite.Empty(results[0].Secret)
+	suite.Contains(results[0].Error, "rolled back")
+	suite.Equal(failure.Error(), results[1].Error)
+	suite.Contains(results[2].Error, "not attempted")
+}
+
+func (suite *RobotV1Suite) TestManifestToRobotSpecsDefaultsAccessEffectToAllow() {
+	manifest := robotV1Manifest{}
+	manifest.Robots = []struct {
+		Name        string `json:"name" yaml:"name"`
+		Description string `json:"description" yaml:"description"`
+		ExpiresAt   int64  `json:"expires_at" yaml:"expires_at"`
+		Access      []struct {
+			Action   string `json:"action" yaml:"action"`
+			Resource string `json:"resource" yaml:"resource"`
+		} `json:"access" yaml:"access"`
+	}{
+		{
+			Name: "ci-robot",
+			Access: []struct {
+				Action   string `json:"action" yaml:"action"`
+				Resource string `json:"resource" yaml:"resource"`
+			}{
+				{Action: "push", Resource: "/project/1/repository"},
+			},
+		},
+	}
+
+	specs := manifestToRobotSpecs(manifest)
+
+	suite.Len(specs, 1)
+	suite.Len(specs[0].Access, 1)
+	suite.Equal("push", specs[0].Access[0].Action)
+	suite.Equal("allow", specs[0].Access[0].Effect)
+}
+
+func TestRobotV1Suite(t *testing.T) {
+	suite.Run(t, new(RobotV1Suite))
+}